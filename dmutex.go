@@ -17,24 +17,45 @@
 package dsync
 
 import (
+	"context"
 	"log"
-	"math"
-	"math/rand"
-	"net/rpc"
 	"sync"
 	"time"
+
+	"github.com/khorevaa/dsync/retry"
 )
 
 const DMutexAcquireTimeout = 25 * time.Millisecond
 
+// lockRetryUnit and lockRetryCap bound the backoff between successive
+// lock attempts: each retry waits a random duration up to unit*2^attempt,
+// capped at cap.
+const (
+	lockRetryUnit = time.Millisecond
+	lockRetryCap  = time.Second
+)
+
+// heartbeatInterval is how often a held lock is renewed against every node
+// that granted it, well inside lockLeaseTTL so a node missing one or two
+// heartbeats doesn't mistake a live holder for a crashed one.
+const heartbeatInterval = lockLeaseTTL / 3
+
 // A DMutex is a distributed mutual exclusion lock.
 type DMutex struct {
-	Name  string
-	locks []bool     // Array of nodes that granted a lock
-	m     sync.Mutex // Mutex to prevent multiple simultaneous locks from this node
+	Name          string
+	locks         []bool        // Array of nodes that granted a lock
+	tolerance     int           // Tolerance the lock was last acquired with, needed to re-check quorum on Unlock
+	uid           string        // UID of the current acquisition, echoed back on Unlock
+	m             sync.Mutex    // Mutex to prevent multiple simultaneous locks from this node
+	stopHeartbeat chan struct{} // closed by Unlock to stop heartbeating the current acquisition
+
+	clnt *Dsync
+}
 
-	// TODO: Decide: create per object or create once for whole class
-	clnts []*rpc.Client
+// NewDMutex creates a new distributed mutex named name, backed by the
+// lock clients held by ds.
+func NewDMutex(ds *Dsync, name string) *DMutex {
+	return &DMutex{clnt: ds, Name: name}
 }
 
 type Granted struct {
@@ -42,79 +63,78 @@ type Granted struct {
 	locked bool
 }
 
-func connectLazy(dm *DMutex) {
-	if dm.clnts == nil {
-		dm.clnts = make([]*rpc.Client, n)
-	}
-	for i := range dm.clnts {
-		if dm.clnts[i] != nil {
-			continue
-		}
-		dm.clnts[i], _ = rpc.DialHTTPPath("tcp", nodes[i], rpcPath)
-	}
-}
-
-// Lock locks dm.
+// Lock locks dm using the given Options.
 //
-// If the lock is already in use, the calling goroutine
-// blocks until the mutex is available.
-func (dm *DMutex) Lock() {
+// If the lock is already in use, the calling goroutine blocks, retrying
+// with backoff, until the mutex is available or ctx is done, in which case
+// Lock returns ctx.Err().
+func (dm *DMutex) Lock(ctx context.Context, opts Options) error {
+
+	if err := opts.validate(len(dm.clnt.clnts)); err != nil {
+		return err
+	}
 
 	// Shield Lock() with local mutex in order to prevent more than
 	// one broadcast going out at the same time from this node
 	dm.m.Lock()
 	defer dm.m.Unlock()
 
-	runs, backOff := 1, 1
+	uid := generateUID()
 
+	timer := retry.NewTimer(lockRetryUnit, lockRetryCap, retry.FullJitter)
 	for {
-		connectLazy(dm)
-		locks := make([]bool, n)
-		success := lock(dm.clnts, &locks, dm.Name)
-		if success {
-			dm.locks = make([]bool, n)
-			copy(dm.locks, locks[:])
-			return
+		if _, ok := timer.Next(ctx); !ok {
+			break
 		}
 
-		// We timed out on the previous lock, incrementally wait for a longer back-off time,
-		// and try again afterwards
-		time.Sleep(time.Duration(backOff) * time.Millisecond)
-
-		backOff += int(rand.Float64() * math.Pow(2, float64(runs)))
-		if backOff > 1024 {
-			backOff = backOff % 64
-
-			runs = 1 // reset runs
-		} else if runs < 10 {
-			runs++
+		locks := make([]bool, len(dm.clnt.clnts))
+		success := lock(dm.clnt.clnts, &locks, dm.Name, uid, false, opts)
+		if success {
+			dm.locks = make([]bool, len(locks))
+			copy(dm.locks, locks[:])
+			dm.tolerance = opts.Tolerance
+			dm.uid = uid
+			dm.stopHeartbeat = make(chan struct{})
+			go heartbeat(dm.clnt.clnts, locks, dm.Name, uid, dm.stopHeartbeat)
+			return nil
 		}
-
-		//fmt.Println(backOff)
 	}
+
+	return ctx.Err()
 }
 
 // lock tries to acquire the distributed lock, returning true or false
 //
-func lock(clnts []*rpc.Client, locks *[]bool, lockName string) bool {
+// isReadLock selects whether we broadcast a shared (RLock) or exclusive
+// (Lock) request; the quorum/timeout machinery below is identical for both.
+// opts.Tolerance controls how many grant failures we tolerate before
+// giving up early, and opts.Timeout bounds how long we wait for responses.
+// uid identifies this acquisition and is echoed back on release.
+func lock(clnts []NetLocker, locks *[]bool, lockName string, uid string, isReadLock bool, opts Options) bool {
+
+	n := len(clnts)
 
-	// Create buffered channel of quorum size
-	ch := make(chan Granted, n/2+1)
+	// Create buffered channel of node size
+	ch := make(chan Granted, n)
 
 	for index, c := range clnts {
 
 		// broadcast lock request to all nodes
-		go func(index int, c *rpc.Client) {
+		go func(index int, c NetLocker) {
 			// All client methods issuing RPCs are thread-safe and goroutine-safe,
 			// i.e. it is safe to call them from multiple concurrently running go routines.
-			var status bool
-			err := c.Call("Dsync.Lock", lockName, &status)
+			args := LockArgs{Resource: lockName, UID: uid}
 
-			locked := false
-			if err == nil {
-				locked = status
+			var locked bool
+			var err error
+			if isReadLock {
+				locked, err = c.RLock(args)
 			} else {
+				locked, err = c.Lock(args)
+			}
+			if err != nil {
 				// silently ignore error, retry later
+				locked = false
 			}
 
 			ch <- Granted{index: index, locked: locked}
@@ -129,41 +149,50 @@ func lock(clnts []*rpc.Client, locks *[]bool, lockName string) bool {
 
 	go func() {
 
-		// Wait until we have received (minimally) quorum number of responses or timeout
-		i := 0
+		// Wait until we have received (minimally) quorum number of responses or timeout.
+		// received counts actual messages taken off ch, independent of how many
+		// iterations the loop below ran, so the drain loop after wg.Done() knows
+		// exactly how many sends are still outstanding - a break out of an
+		// iteration that already consumed a message must not lose that count.
+		received := 0
 		done := false
-		timeout := time.After(DMutexAcquireTimeout)
+		locksFailed := 0
+		acquireTimeout := opts.Timeout
+		if acquireTimeout <= 0 {
+			acquireTimeout = DMutexAcquireTimeout
+		}
+		timeout := time.After(acquireTimeout)
 
-		for ; i < n; i++ {
+		for !done && received < n {
 
 			select {
 			case grant := <-ch:
+				received++
 				if grant.locked {
 					// Mark that this node has acquired the lock
 					(*locks)[grant.index] = true
 				} else {
-					done = true
-					//fmt.Println("one lock failed before quorum -- release locks acquired")
-					releaseAll(clnts, locks, lockName)
+					locksFailed++
+					if locksFailed > opts.Tolerance {
+						done = true
+						//fmt.Println("too many locks failed before quorum -- release locks acquired")
+						releaseAll(clnts, locks, lockName, uid, isReadLock)
+					}
 				}
 
 			case <-timeout:
 				done = true
 				// timeout happened, maybe one of the nodes is slow, count
 				// number of locks to check whether we have quorum or not
-				if !quorumMet(locks) {
+				if !quorumMet(locks, opts.Tolerance) {
 					//fmt.Println("timed out -- release locks acquired")
-					releaseAll(clnts, locks, lockName)
+					releaseAll(clnts, locks, lockName, uid, isReadLock)
 				}
 			}
-
-			if done {
-				break
-			}
 		}
 
 		// Count locks in order to determine whterh we have quorum or not
-		quorum = quorumMet(locks)
+		quorum = quorumMet(locks, opts.Tolerance)
 
 		// Signal that we have the quorum
 		wg.Done()
@@ -171,11 +200,11 @@ func lock(clnts []*rpc.Client, locks *[]bool, lockName string) bool {
 		// Wait for the other responses and immediately release the locks
 		// (do not add them to the locks array because the DMutex could
 		//  already has been unlocked again by the original calling thread)
-		for ; i < n; i++ {
+		for ; received < n; received++ {
 			grantToBeReleased := <-ch
 			if grantToBeReleased.locked {
 				// release lock
-				go sendRelease(clnts[grantToBeReleased.index], lockName)
+				go sendRelease(clnts[grantToBeReleased.index], lockName, uid, isReadLock)
 			}
 		}
 	}()
@@ -185,8 +214,8 @@ func lock(clnts []*rpc.Client, locks *[]bool, lockName string) bool {
 	return quorum
 }
 
-// quorumMet determines whether we have acquired n/2+1 underlying locks or not
-func quorumMet(locks *[]bool) bool {
+// quorumMet determines whether we have acquired len(locks)-tolerance underlying locks or not
+func quorumMet(locks *[]bool, tolerance int) bool {
 
 	count := 0
 	for _, locked := range *locks {
@@ -195,40 +224,54 @@ func quorumMet(locks *[]bool) bool {
 		}
 	}
 
-	return count >= n/2+1
+	return count >= len(*locks)-tolerance
 }
 
 // releaseAll releases all locks that are marked as locked
-func releaseAll(clnts []*rpc.Client, locks *[]bool, lockName string) {
+func releaseAll(clnts []NetLocker, locks *[]bool, lockName string, uid string, isReadLock bool) {
 
-	for lock := 0; lock < n; lock++ {
+	for lock := 0; lock < len(*locks); lock++ {
 		if (*locks)[lock] {
-			go sendRelease(clnts[lock], lockName)
+			go sendRelease(clnts[lock], lockName, uid, isReadLock)
 			(*locks)[lock] = false
 		}
 	}
 
 }
 
-// hasLock returns whether or not a node participated in granting the lock
-func (dm *DMutex) hasLock(node string) bool {
+// heartbeat periodically renews uid against every node that granted it,
+// until stop is closed, so a node's lease on the lock doesn't lapse while
+// the holder is still alive. It does not retry or escalate a failed
+// renewal; a missed heartbeat is made up for by the next tick, and a node
+// that reports it no longer recognizes uid has already reaped it, so there
+// is nothing left to renew there.
+func heartbeat(clnts []NetLocker, locks []bool, lockName string, uid string, stop <-chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
 
-	for index, n := range nodes {
-		if n == node {
-			return dm.locks[index]
+	for {
+		select {
+		case <-ticker.C:
+			args := LockArgs{Resource: lockName, UID: uid}
+			for index, c := range clnts {
+				if !locks[index] {
+					continue
+				}
+				go c.Refresh(args)
+			}
+		case <-stop:
+			return
 		}
 	}
-
-	return false
 }
 
 // locked returns whether or not we have met the quorum
 func (dm *DMutex) locked() bool {
 
-	locks := make([]bool, n)
+	locks := make([]bool, len(dm.locks))
 	copy(locks[:], dm.locks[:])
 
-	return quorumMet(&locks)
+	return quorumMet(&locks, dm.tolerance)
 }
 
 // Unlock unlocks dm.
@@ -241,14 +284,16 @@ func (dm *DMutex) Unlock() {
 		panic("dsync: unlock of unlocked distributed mutex")
 	}
 
+	close(dm.stopHeartbeat)
+
 	// We don't need to wait until we have released all the locks (or the quorum)
 	// (a subsequent lock will retry automatically in case it would fail to get
 	//  quorum)
-	for index, c := range dm.clnts {
+	for index, c := range dm.clnt.clnts {
 
 		if dm.locks[index] {
 			// broadcast lock release to all nodes the granted the lock
-			go sendRelease(c, dm.Name)
+			go sendRelease(c, dm.Name, dm.uid, false)
 
 			dm.locks[index] = false
 		}
@@ -256,12 +301,19 @@ func (dm *DMutex) Unlock() {
 }
 
 // sendRelease sends a release message to a node that previously granted a lock
-func sendRelease(c *rpc.Client, name string) {
+func sendRelease(c NetLocker, name string, uid string, isReadLock bool) {
 
 	// All client methods issuing RPCs are thread-safe and goroutine-safe,
 	// i.e. it is safe to call them from multiple concurrently running goroutines.
-	var status bool
-	if err := c.Call("Dsync.Unlock", name, &status); err != nil {
-		log.Fatal("Unlock on %s failed on client %v", name, c)
+	args := LockArgs{Resource: name, UID: uid}
+
+	var err error
+	if isReadLock {
+		err = c.RUnlock(args)
+	} else {
+		err = c.Unlock(args)
+	}
+	if err != nil {
+		log.Printf("Unlock on %s failed: %v", name, err)
 	}
 }
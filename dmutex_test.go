@@ -0,0 +1,117 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// clusterWithDownNodes returns a local cluster of n nodes where the first
+// down of them are unreachable, so tests can exercise Options.Tolerance
+// against a fixed number of simulated failures.
+func clusterWithDownNodes(n, down int) []NetLocker {
+	clnts := newLocalCluster(n)
+	for i := 0; i < down; i++ {
+		clnts[i] = downLocker{}
+	}
+	return clnts
+}
+
+func TestLockToleratesUpToNFailures(t *testing.T) {
+	ds, err := NewDsync(clusterWithDownNodes(5, 2))
+	if err != nil {
+		t.Fatalf("NewDsync() error = %v", err)
+	}
+
+	dm := NewDMutex(ds, "resource")
+	opts := Options{Tolerance: 2, Timeout: 20 * time.Millisecond}
+
+	if err := dm.Lock(context.Background(), opts); err != nil {
+		t.Fatalf("Lock() error = %v, want success tolerating 2 of 5 nodes down", err)
+	}
+	dm.Unlock()
+}
+
+func TestLockFailsWhenFailuresExceedTolerance(t *testing.T) {
+	ds, err := NewDsync(clusterWithDownNodes(5, 3))
+	if err != nil {
+		t.Fatalf("NewDsync() error = %v", err)
+	}
+
+	dm := NewDMutex(ds, "resource")
+	opts := Options{Tolerance: 2, Timeout: 20 * time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if err := dm.Lock(ctx, opts); err == nil {
+		dm.Unlock()
+		t.Fatal("Lock() succeeded with 3 of 5 nodes down and Tolerance 2, want failure")
+	}
+}
+
+// TestLockEarlyAbortDoesNotLeakGoroutines guards against the response-drain
+// loop in lock() miscounting how many ch sends are still outstanding after
+// an early abort: it used to believe one more was pending than actually
+// remained, parking the drain goroutine on a channel read that would never
+// be satisfied.
+func TestLockEarlyAbortDoesNotLeakGoroutines(t *testing.T) {
+	baseline := goroutinesSettled(t)
+
+	clnts := clusterWithDownNodes(4, 2)
+	locks := make([]bool, len(clnts))
+	opts := Options{Tolerance: 0, Timeout: 50 * time.Millisecond}
+
+	if got := lock(clnts, &locks, "resource", generateUID(), false, opts); got {
+		t.Fatal("lock() succeeded with 2 of 4 nodes down and Tolerance 0, want failure")
+	}
+
+	after := goroutinesSettled(t)
+	if after > baseline {
+		t.Fatalf("runtime.NumGoroutine() = %d after lock()'s early abort, want back to baseline %d", after, baseline)
+	}
+}
+
+// goroutinesSettled returns a stable runtime.NumGoroutine() reading,
+// retrying briefly so goroutines already on their way out (e.g. the
+// fire-and-forget release goroutines spawned by releaseAll) have a chance
+// to finish instead of producing a flaky comparison.
+func goroutinesSettled(t *testing.T) int {
+	t.Helper()
+
+	var n int
+	for i := 0; i < 50; i++ {
+		runtime.Gosched()
+		n = runtime.NumGoroutine()
+		time.Sleep(time.Millisecond)
+	}
+	return n
+}
+
+func TestQuorumMetRespectsTolerance(t *testing.T) {
+	locks := []bool{true, true, false, false, false}
+
+	if quorumMet(&locks, 2) {
+		t.Fatal("quorumMet() = true with only 2 of 5 granted and tolerance 2, want false")
+	}
+	if !quorumMet(&locks, 3) {
+		t.Fatal("quorumMet() = false with 2 of 5 granted and tolerance 3, want true")
+	}
+}
@@ -0,0 +1,148 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"sync"
+
+	"github.com/khorevaa/dsync/retry"
+)
+
+// A DRWMutex is a distributed mutual exclusion lock that, unlike DMutex,
+// also allows many simultaneous readers to hold the lock as long as no
+// writer holds it.
+type DRWMutex struct {
+	Name          string
+	locks         []bool        // Array of nodes that granted a lock
+	tolerance     int           // Tolerance the lock was last acquired with, needed to re-check quorum on Unlock/RUnlock
+	uid           string        // UID of the current acquisition, echoed back on Unlock/RUnlock
+	m             sync.Mutex    // Mutex to prevent multiple simultaneous locks from this node
+	stopHeartbeat chan struct{} // closed by Unlock/RUnlock to stop heartbeating the current acquisition
+
+	clnt *Dsync
+}
+
+// NewDRWMutex creates a new distributed read/write mutex named name,
+// backed by the lock clients held by ds.
+func NewDRWMutex(ds *Dsync, name string) *DRWMutex {
+	return &DRWMutex{clnt: ds, Name: name}
+}
+
+// Lock locks dm for writing using the given Options.
+//
+// If the lock is already in use, the calling goroutine blocks, retrying
+// with backoff, until the mutex is available or ctx is done, in which case
+// Lock returns ctx.Err().
+func (dm *DRWMutex) Lock(ctx context.Context, opts Options) error {
+	return dm.lock(ctx, false, opts)
+}
+
+// RLock locks dm for reading using the given Options.
+//
+// If the lock is already held for writing, the calling goroutine blocks,
+// retrying with backoff, until the mutex is available or ctx is done, in
+// which case RLock returns ctx.Err().
+func (dm *DRWMutex) RLock(ctx context.Context, opts Options) error {
+	return dm.lock(ctx, true, opts)
+}
+
+// lock acquires dm, broadcasting either a read or a write lock request to
+// all nodes and retrying with a back-off until quorum is reached or ctx is
+// done.
+func (dm *DRWMutex) lock(ctx context.Context, isReadLock bool, opts Options) error {
+
+	if err := opts.validate(len(dm.clnt.clnts)); err != nil {
+		return err
+	}
+
+	// Shield the lock attempt with a local mutex in order to prevent more
+	// than one broadcast going out at the same time from this node
+	dm.m.Lock()
+	defer dm.m.Unlock()
+
+	uid := generateUID()
+
+	timer := retry.NewTimer(lockRetryUnit, lockRetryCap, retry.FullJitter)
+	for {
+		if _, ok := timer.Next(ctx); !ok {
+			break
+		}
+
+		locks := make([]bool, len(dm.clnt.clnts))
+		success := lock(dm.clnt.clnts, &locks, dm.Name, uid, isReadLock, opts)
+		if success {
+			dm.locks = make([]bool, len(locks))
+			copy(dm.locks, locks[:])
+			dm.tolerance = opts.Tolerance
+			dm.uid = uid
+			dm.stopHeartbeat = make(chan struct{})
+			go heartbeat(dm.clnt.clnts, locks, dm.Name, uid, dm.stopHeartbeat)
+			return nil
+		}
+	}
+
+	return ctx.Err()
+}
+
+// Unlock unlocks dm for writing.
+//
+// It is a run-time error if dm is not locked on entry to Unlock. Whether
+// dm was locked for writing rather than for reading is not checked.
+func (dm *DRWMutex) Unlock() {
+	dm.unlock(false)
+}
+
+// RUnlock unlocks dm for reading.
+//
+// It is a run-time error if dm is not locked on entry to RUnlock. Whether
+// dm was locked for reading rather than for writing is not checked.
+func (dm *DRWMutex) RUnlock() {
+	dm.unlock(true)
+}
+
+func (dm *DRWMutex) unlock(isReadLock bool) {
+
+	// Verify that we have the lock or panic otherwise (similar to sync.mutex)
+	if !dm.locked() {
+		panic("dsync: unlock of unlocked distributed rw mutex")
+	}
+
+	close(dm.stopHeartbeat)
+
+	// We don't need to wait until we have released all the locks (or the quorum)
+	// (a subsequent lock will retry automatically in case it would fail to get
+	//  quorum)
+	for index, c := range dm.clnt.clnts {
+
+		if dm.locks[index] {
+			// broadcast lock release to all nodes that granted the lock
+			go sendRelease(c, dm.Name, dm.uid, isReadLock)
+
+			dm.locks[index] = false
+		}
+	}
+}
+
+// locked returns whether or not we have met the quorum
+func (dm *DRWMutex) locked() bool {
+
+	locks := make([]bool, len(dm.locks))
+	copy(locks[:], dm.locks[:])
+
+	return quorumMet(&locks, dm.tolerance)
+}
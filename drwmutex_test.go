@@ -0,0 +1,90 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestDRWMutexAllowsConcurrentReaders(t *testing.T) {
+	ds, err := NewDsync(newLocalCluster(3))
+	if err != nil {
+		t.Fatalf("NewDsync() error = %v", err)
+	}
+
+	a := NewDRWMutex(ds, "resource")
+	b := NewDRWMutex(ds, "resource")
+	opts := ds.DefaultOptions()
+
+	if err := a.RLock(context.Background(), opts); err != nil {
+		t.Fatalf("a.RLock() error = %v", err)
+	}
+	defer a.RUnlock()
+
+	if err := b.RLock(context.Background(), opts); err != nil {
+		t.Fatalf("b.RLock() error = %v, want a second reader to be let in", err)
+	}
+	defer b.RUnlock()
+}
+
+func TestDRWMutexWriterExcludesReaders(t *testing.T) {
+	ds, err := NewDsync(newLocalCluster(3))
+	if err != nil {
+		t.Fatalf("NewDsync() error = %v", err)
+	}
+
+	w := NewDRWMutex(ds, "resource")
+	r := NewDRWMutex(ds, "resource")
+	opts := ds.DefaultOptions()
+
+	if err := w.Lock(context.Background(), opts); err != nil {
+		t.Fatalf("w.Lock() error = %v", err)
+	}
+	defer w.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := r.RLock(ctx, opts); err == nil {
+		r.RUnlock()
+		t.Fatal("r.RLock() succeeded while a writer held the lock, want it to fail")
+	}
+}
+
+func TestDRWMutexWritersAreExclusive(t *testing.T) {
+	ds, err := NewDsync(newLocalCluster(3))
+	if err != nil {
+		t.Fatalf("NewDsync() error = %v", err)
+	}
+
+	a := NewDRWMutex(ds, "resource")
+	b := NewDRWMutex(ds, "resource")
+	opts := ds.DefaultOptions()
+
+	if err := a.Lock(context.Background(), opts); err != nil {
+		t.Fatalf("a.Lock() error = %v", err)
+	}
+	defer a.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := b.Lock(ctx, opts); err == nil {
+		b.Unlock()
+		t.Fatal("b.Lock() succeeded while a was still held, want it to fail")
+	}
+}
@@ -0,0 +1,79 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import "errors"
+
+// Dsync holds the set of lock clients that make up a distributed lock
+// cluster. DMutex and DRWMutex carry a *Dsync instead of reaching for
+// package-level state, so a single process can drive more than one
+// cluster and tests can wire in fake NetLockers.
+type Dsync struct {
+	clnts []NetLocker
+}
+
+// NewDsync creates a Dsync from a set of lock clients, one per node of the
+// cluster. At least two clients are required for quorum to be meaningful.
+func NewDsync(clnts []NetLocker) (*Dsync, error) {
+	if len(clnts) < 2 {
+		return nil, errors.New("dsync: at least two lock clients are required")
+	}
+
+	return &Dsync{clnts: clnts}, nil
+}
+
+// NewRPCClients creates a ReconnectRPCClient for each node address using the
+// given rpcPath, returning them as NetLockers ready to pass to NewDsync. No
+// connection is made here; each client dials on its first call.
+func NewRPCClients(nodes []string, rpcPath string) []NetLocker {
+	clnts := make([]NetLocker, len(nodes))
+	for i, addr := range nodes {
+		clnts[i] = newClient(addr, rpcPath)
+	}
+	return clnts
+}
+
+// DefaultOptions returns the Options that reproduce the historical
+// behavior of this package for this cluster: strict majority quorum and
+// the package-wide DMutexAcquireTimeout.
+func (ds *Dsync) DefaultOptions() Options {
+	n := len(ds.clnts)
+	return Options{
+		Tolerance: (n - 1) / 2,
+		Timeout:   DMutexAcquireTimeout,
+	}
+}
+
+// ForceUnlock administratively clears name on every node, regardless of
+// who (if anyone) currently holds it. Use this to recover a lock wedged
+// by a client that crashed between acquisition and release.
+func (ds *Dsync) ForceUnlock(name string) error {
+	var firstErr error
+	for _, c := range ds.clnts {
+		if err := c.ForceUnlock(LockArgs{Resource: name}); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// NewLockServer returns a LockServer backed by this cluster's peers, for
+// a process that wants to both request locks (as a Dsync client) and
+// grant them (as a Dsync.* RPC handler).
+func (ds *Dsync) NewLockServer() *LockServer {
+	return newLockServer(ds.clnts, ds.DefaultOptions().Tolerance)
+}
@@ -0,0 +1,66 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"testing"
+)
+
+func TestNewDsyncRequiresAtLeastTwoClients(t *testing.T) {
+	if _, err := NewDsync(newLocalCluster(1)); err == nil {
+		t.Fatal("NewDsync() succeeded with a single client, want an error")
+	}
+}
+
+func TestDefaultOptionsIsStrictMajority(t *testing.T) {
+	ds, err := NewDsync(newLocalCluster(5))
+	if err != nil {
+		t.Fatalf("NewDsync() error = %v", err)
+	}
+
+	got := ds.DefaultOptions().Tolerance
+	if want := 2; got != want {
+		t.Fatalf("DefaultOptions().Tolerance = %d, want %d for a 5-node cluster", got, want)
+	}
+}
+
+func TestForceUnlockClearsLockOnEveryPeer(t *testing.T) {
+	clnts := newLocalCluster(3)
+	ds, err := NewDsync(clnts)
+	if err != nil {
+		t.Fatalf("NewDsync() error = %v", err)
+	}
+
+	dm := NewDMutex(ds, "resource")
+	if err := dm.Lock(context.Background(), ds.DefaultOptions()); err != nil {
+		t.Fatalf("Lock() error = %v", err)
+	}
+	defer dm.Unlock()
+
+	if err := ds.ForceUnlock("resource"); err != nil {
+		t.Fatalf("ForceUnlock() error = %v", err)
+	}
+
+	// A fresh acquisition from a different mutex should now succeed
+	// immediately, proving every peer's grant was cleared.
+	other := NewDMutex(ds, "resource")
+	if err := other.Lock(context.Background(), ds.DefaultOptions()); err != nil {
+		t.Fatalf("Lock() after ForceUnlock() error = %v, want the resource to be free", err)
+	}
+	other.Unlock()
+}
@@ -0,0 +1,306 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// lockLeaseTTL bounds how long a grant is considered live without a
+// Refresh. A holder that stops heartbeating - most commonly because it
+// crashed between acquisition and release - falls outside its lease after
+// this long, letting Expired (and so reapExpiredLocks) recognize the grant
+// as stale even though no Unlock/RUnlock ever arrives for it.
+const lockLeaseTTL = time.Minute
+
+// lockInfo records who holds a lock and when, so Unlock/RUnlock can
+// verify the UID matches and stale-lock maintenance can tell a grant
+// whose lease has lapsed from one a live client is still renewing.
+type lockInfo struct {
+	uid        string
+	acquiredAt time.Time
+	renewedAt  time.Time
+}
+
+// LockServer is a reference implementation of the Dsync.* RPC handlers
+// (Lock, Unlock, RLock, RUnlock, ForceUnlock, Refresh, Expired) described
+// by NetLocker: it holds the per-name lock table on behalf of whichever
+// process registers it with net/rpc under the name "Dsync". Each name is
+// free, held by one writer, or held by any number of readers. Holders
+// heartbeat via Refresh to keep their lease alive; a lease that lapses
+// without a Refresh makes the grant look stale to Expired even though no
+// Unlock/RUnlock for it ever arrives - the common signature of a client
+// that crashed between acquisition and release.
+//
+// A LockServer also knows its peers so it can run stale-lock maintenance:
+// a ticker that periodically asks a quorum of them whether each lock it
+// still holds is one they recognize as live too, and reaps the ones that
+// aren't.
+type LockServer struct {
+	mutex sync.Mutex
+
+	writer  map[string]lockInfo
+	readers map[string]map[string]lockInfo // resource -> uid -> lockInfo
+
+	peers     []NetLocker
+	tolerance int
+}
+
+// newLockServer returns a LockServer whose stale-lock maintenance queries
+// peers, requiring agreement from all but tolerance of them.
+func newLockServer(peers []NetLocker, tolerance int) *LockServer {
+	return &LockServer{
+		writer:    make(map[string]lockInfo),
+		readers:   make(map[string]map[string]lockInfo),
+		peers:     peers,
+		tolerance: tolerance,
+	}
+}
+
+// Lock grants an exclusive lock on args.Resource if it is currently free.
+func (l *LockServer) Lock(args LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, hasWriter := l.writer[args.Resource]; hasWriter || len(l.readers[args.Resource]) > 0 {
+		*reply = false
+		return nil
+	}
+
+	now := time.Now()
+	l.writer[args.Resource] = lockInfo{uid: args.UID, acquiredAt: now, renewedAt: now}
+	*reply = true
+	return nil
+}
+
+// Unlock releases the exclusive lock on args.Resource, if args.UID is the
+// one that currently holds it.
+func (l *LockServer) Unlock(args LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	info, ok := l.writer[args.Resource]
+	if !ok || info.uid != args.UID {
+		*reply = false
+		return nil
+	}
+
+	delete(l.writer, args.Resource)
+	*reply = true
+	return nil
+}
+
+// RLock grants a shared lock on args.Resource if no writer currently
+// holds it.
+func (l *LockServer) RLock(args LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if _, hasWriter := l.writer[args.Resource]; hasWriter {
+		*reply = false
+		return nil
+	}
+
+	if l.readers[args.Resource] == nil {
+		l.readers[args.Resource] = make(map[string]lockInfo)
+	}
+	now := time.Now()
+	l.readers[args.Resource][args.UID] = lockInfo{uid: args.UID, acquiredAt: now, renewedAt: now}
+	*reply = true
+	return nil
+}
+
+// RUnlock releases the shared lock held by args.UID on args.Resource.
+func (l *LockServer) RUnlock(args LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	readers := l.readers[args.Resource]
+	if readers == nil {
+		*reply = false
+		return nil
+	}
+	if _, ok := readers[args.UID]; !ok {
+		*reply = false
+		return nil
+	}
+
+	delete(readers, args.UID)
+	if len(readers) == 0 {
+		delete(l.readers, args.Resource)
+	}
+	*reply = true
+	return nil
+}
+
+// ForceUnlock clears args.Resource regardless of who holds it.
+func (l *LockServer) ForceUnlock(args LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	delete(l.writer, args.Resource)
+	delete(l.readers, args.Resource)
+	*reply = true
+	return nil
+}
+
+// Refresh renews the lease on args.UID for args.Resource, reporting
+// whether this node still recognizes that acquisition.
+func (l *LockServer) Refresh(args LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if info, ok := l.writer[args.Resource]; ok && info.uid == args.UID {
+		info.renewedAt = time.Now()
+		l.writer[args.Resource] = info
+		*reply = true
+		return nil
+	}
+	if readers := l.readers[args.Resource]; readers != nil {
+		if info, ok := readers[args.UID]; ok {
+			info.renewedAt = time.Now()
+			readers[args.UID] = info
+			*reply = true
+			return nil
+		}
+	}
+
+	*reply = false
+	return nil
+}
+
+// Expired reports whether this node no longer considers args.UID a live
+// grant for args.Resource: either it has no record of args.UID at all, or
+// it does but the lease has lapsed without a Refresh within lockLeaseTTL -
+// the case a client that crashed between acquisition and release leaves
+// behind, since no Unlock/RUnlock will ever arrive for it.
+func (l *LockServer) Expired(args LockArgs, reply *bool) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if info, ok := l.writer[args.Resource]; ok && info.uid == args.UID {
+		*reply = time.Since(info.renewedAt) > lockLeaseTTL
+		return nil
+	}
+	if readers := l.readers[args.Resource]; readers != nil {
+		if info, ok := readers[args.UID]; ok {
+			*reply = time.Since(info.renewedAt) > lockLeaseTTL
+			return nil
+		}
+	}
+
+	*reply = true
+	return nil
+}
+
+// StartStaleLockMaintenance runs a periodic sweep, with a randomized
+// initial phase so peer nodes don't all tick in lockstep, that reaps any
+// lock this node holds but a quorum of its peers no longer recognize.
+// It stops when ctx is done.
+func (l *LockServer) StartStaleLockMaintenance(ctx context.Context, interval time.Duration) {
+	go func() {
+		initialPhase := time.Duration(rand.Int63n(int64(interval)))
+
+		timer := time.NewTimer(initialPhase)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return
+		}
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			l.reapExpiredLocks()
+
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+type heldLock struct {
+	resource string
+	uid      string
+	isRead   bool
+}
+
+// reapExpiredLocks checks every lock currently held by this node against
+// its peers and removes the ones a quorum no longer recognizes.
+func (l *LockServer) reapExpiredLocks() {
+	l.mutex.Lock()
+	held := make([]heldLock, 0, len(l.writer)+len(l.readers))
+	for resource, info := range l.writer {
+		held = append(held, heldLock{resource: resource, uid: info.uid})
+	}
+	for resource, readers := range l.readers {
+		for uid := range readers {
+			held = append(held, heldLock{resource: resource, uid: uid, isRead: true})
+		}
+	}
+	l.mutex.Unlock()
+
+	for _, h := range held {
+		if l.quorumConsidersExpired(h.resource, h.uid) {
+			l.reap(h)
+		}
+	}
+}
+
+// quorumConsidersExpired asks every peer whether it still recognizes uid
+// for resource, and reports whether all but tolerance of them say no.
+func (l *LockServer) quorumConsidersExpired(resource, uid string) bool {
+	args := LockArgs{Resource: resource, UID: uid}
+
+	votes := 0
+	for _, peer := range l.peers {
+		expired, err := peer.Expired(args)
+		if err == nil && expired {
+			votes++
+		}
+	}
+
+	return votes >= len(l.peers)-l.tolerance
+}
+
+func (l *LockServer) reap(h heldLock) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if h.isRead {
+		if readers := l.readers[h.resource]; readers != nil {
+			delete(readers, h.uid)
+			if len(readers) == 0 {
+				delete(l.readers, h.resource)
+			}
+		}
+		return
+	}
+
+	if info, ok := l.writer[h.resource]; ok && info.uid == h.uid {
+		delete(l.writer, h.resource)
+	}
+}
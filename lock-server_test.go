@@ -0,0 +1,123 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExpiredOnUnknownUID(t *testing.T) {
+	l := newLockServer(nil, 0)
+
+	var expired bool
+	if err := l.Expired(LockArgs{Resource: "r", UID: "nobody"}, &expired); err != nil {
+		t.Fatalf("Expired() error = %v", err)
+	}
+	if !expired {
+		t.Fatal("Expired() = false for a UID this node never granted, want true")
+	}
+}
+
+func TestRefreshKeepsLeaseAlive(t *testing.T) {
+	l := newLockServer(nil, 0)
+	args := LockArgs{Resource: "r", UID: "u1"}
+
+	var granted bool
+	if err := l.Lock(args, &granted); err != nil || !granted {
+		t.Fatalf("Lock() = %v, %v, want true, nil", granted, err)
+	}
+
+	var expired bool
+	if err := l.Expired(args, &expired); err != nil || expired {
+		t.Fatalf("Expired() = %v, %v right after Lock, want false, nil", expired, err)
+	}
+
+	// Simulate the lease lapsing without a Refresh.
+	info := l.writer[args.Resource]
+	info.renewedAt = time.Now().Add(-2 * lockLeaseTTL)
+	l.writer[args.Resource] = info
+
+	if err := l.Expired(args, &expired); err != nil || !expired {
+		t.Fatalf("Expired() = %v, %v after the lease lapsed, want true, nil", expired, err)
+	}
+
+	var refreshed bool
+	if err := l.Refresh(args, &refreshed); err != nil || !refreshed {
+		t.Fatalf("Refresh() = %v, %v, want true, nil", refreshed, err)
+	}
+
+	if err := l.Expired(args, &expired); err != nil || expired {
+		t.Fatalf("Expired() = %v, %v after Refresh, want false, nil", expired, err)
+	}
+}
+
+func TestRefreshFailsForUnrecognizedUID(t *testing.T) {
+	l := newLockServer(nil, 0)
+
+	var refreshed bool
+	if err := l.Refresh(LockArgs{Resource: "r", UID: "nobody"}, &refreshed); err != nil {
+		t.Fatalf("Refresh() error = %v", err)
+	}
+	if refreshed {
+		t.Fatal("Refresh() = true for a UID this node never granted, want false")
+	}
+}
+
+// fakeExpiredPeer answers every Expired call with a fixed verdict.
+type fakeExpiredPeer struct {
+	NetLocker
+	expired bool
+}
+
+func (f *fakeExpiredPeer) Expired(args LockArgs) (bool, error) {
+	return f.expired, nil
+}
+
+func TestReapExpiredLocksRemovesGrantNoQuorumRecognizes(t *testing.T) {
+	peers := []NetLocker{&fakeExpiredPeer{expired: true}, &fakeExpiredPeer{expired: true}}
+	l := newLockServer(peers, 0)
+
+	args := LockArgs{Resource: "r", UID: "u1"}
+	var granted bool
+	if err := l.Lock(args, &granted); err != nil || !granted {
+		t.Fatalf("Lock() = %v, %v, want true, nil", granted, err)
+	}
+
+	l.reapExpiredLocks()
+
+	if _, ok := l.writer[args.Resource]; ok {
+		t.Fatal("writer lock still present after a quorum of peers reported it expired")
+	}
+}
+
+func TestReapExpiredLocksKeepsGrantPeersStillRecognize(t *testing.T) {
+	peers := []NetLocker{&fakeExpiredPeer{expired: false}, &fakeExpiredPeer{expired: false}}
+	l := newLockServer(peers, 0)
+
+	args := LockArgs{Resource: "r", UID: "u1"}
+	var granted bool
+	if err := l.Lock(args, &granted); err != nil || !granted {
+		t.Fatalf("Lock() = %v, %v, want true, nil", granted, err)
+	}
+
+	l.reapExpiredLocks()
+
+	if _, ok := l.writer[args.Resource]; !ok {
+		t.Fatal("writer lock removed even though peers still recognize it")
+	}
+}
@@ -0,0 +1,105 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import "errors"
+
+// localLocker adapts a *LockServer to NetLocker in-process, so tests can
+// exercise the quorum/lock logic against a fake cluster without a real
+// net/rpc listener.
+type localLocker struct {
+	server *LockServer
+}
+
+// newLocalCluster returns n NetLockers, each backed by its own LockServer
+// that knows about the others as peers, wired together the way NewDsync
+// expects.
+func newLocalCluster(n int) []NetLocker {
+	servers := make([]*LockServer, n)
+	clnts := make([]NetLocker, n)
+	for i := range servers {
+		servers[i] = newLockServer(nil, 0)
+		clnts[i] = &localLocker{server: servers[i]}
+	}
+
+	for i, s := range servers {
+		peers := make([]NetLocker, 0, n-1)
+		for j, c := range clnts {
+			if j != i {
+				peers = append(peers, c)
+			}
+		}
+		s.peers = peers
+	}
+
+	return clnts
+}
+
+func (l *localLocker) Lock(args LockArgs) (bool, error) {
+	var reply bool
+	err := l.server.Lock(args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) Unlock(args LockArgs) error {
+	var reply bool
+	return l.server.Unlock(args, &reply)
+}
+
+func (l *localLocker) RLock(args LockArgs) (bool, error) {
+	var reply bool
+	err := l.server.RLock(args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) RUnlock(args LockArgs) error {
+	var reply bool
+	return l.server.RUnlock(args, &reply)
+}
+
+func (l *localLocker) ForceUnlock(args LockArgs) error {
+	var reply bool
+	return l.server.ForceUnlock(args, &reply)
+}
+
+func (l *localLocker) Refresh(args LockArgs) (bool, error) {
+	var reply bool
+	err := l.server.Refresh(args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) Expired(args LockArgs) (bool, error) {
+	var reply bool
+	err := l.server.Expired(args, &reply)
+	return reply, err
+}
+
+func (l *localLocker) Close() error { return nil }
+
+// downLocker simulates an unreachable node: every call fails.
+type downLocker struct{}
+
+var errSimulatedDown = errors.New("simulated: node down")
+
+func (downLocker) Lock(LockArgs) (bool, error)    { return false, errSimulatedDown }
+func (downLocker) Unlock(LockArgs) error          { return errSimulatedDown }
+func (downLocker) RLock(LockArgs) (bool, error)   { return false, errSimulatedDown }
+func (downLocker) RUnlock(LockArgs) error         { return errSimulatedDown }
+func (downLocker) ForceUnlock(LockArgs) error     { return errSimulatedDown }
+func (downLocker) Refresh(LockArgs) (bool, error) { return false, errSimulatedDown }
+func (downLocker) Expired(LockArgs) (bool, error) { return false, errSimulatedDown }
+func (downLocker) Close() error                   { return nil }
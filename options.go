@@ -0,0 +1,53 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"errors"
+	"time"
+)
+
+// Options controls how a single Lock/RLock call negotiates quorum.
+type Options struct {
+	// Tolerance is the number of node failures or timeouts that can be
+	// tolerated while still granting the lock: quorum is met once
+	// n - Tolerance nodes have responded with a grant.
+	//
+	// Tolerance must satisfy 2*Tolerance < n: any two quorums then share
+	// at least one node, which is what makes two concurrent Lock/RLock
+	// calls unable to both succeed. A Tolerance of n/2 or higher lets two
+	// disjoint sets of nodes each reach quorum at once and breaks mutual
+	// exclusion entirely, so it is rejected rather than silently honored.
+	Tolerance int
+
+	// Timeout overrides DMutexAcquireTimeout for this call. A zero or
+	// negative Timeout leaves DMutexAcquireTimeout in effect.
+	Timeout time.Duration
+}
+
+// errUnsafeTolerance is returned by Lock/RLock when opts.Tolerance is
+// negative, or too high, relative to the cluster size, to guarantee mutual
+// exclusion.
+var errUnsafeTolerance = errors.New("dsync: Tolerance is negative or too high to guarantee mutual exclusion for this cluster size")
+
+// validate reports whether opts is safe to use against a cluster of n nodes.
+func (opts Options) validate(n int) error {
+	if opts.Tolerance < 0 || 2*opts.Tolerance >= n {
+		return errUnsafeTolerance
+	}
+	return nil
+}
@@ -0,0 +1,59 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"context"
+	"testing"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		tolerance int
+		n         int
+		wantErr   bool
+	}{
+		{tolerance: 0, n: 3, wantErr: false},
+		{tolerance: 1, n: 3, wantErr: false},
+		{tolerance: 2, n: 5, wantErr: false},
+		{tolerance: -1, n: 5, wantErr: true},
+		{tolerance: 2, n: 4, wantErr: true}, // 2*2 >= 4: two disjoint quorums possible
+		{tolerance: 3, n: 5, wantErr: true}, // 2*3 >= 5
+	}
+
+	for _, tt := range tests {
+		err := (Options{Tolerance: tt.tolerance}).validate(tt.n)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("Options{Tolerance: %d}.validate(%d) error = %v, wantErr %v", tt.tolerance, tt.n, err, tt.wantErr)
+		}
+	}
+}
+
+func TestLockRejectsUnsafeTolerance(t *testing.T) {
+	ds, err := NewDsync(newLocalCluster(4))
+	if err != nil {
+		t.Fatalf("NewDsync() error = %v", err)
+	}
+
+	dm := NewDMutex(ds, "resource")
+	opts := Options{Tolerance: 2} // 2*2 >= 4: unsafe for a 4-node cluster
+
+	if err := dm.Lock(context.Background(), opts); err == nil {
+		dm.Unlock()
+		t.Fatal("Lock() succeeded with an unsafe Tolerance, want an error")
+	}
+}
@@ -0,0 +1,130 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+// Package retry provides a cancellable, truncated exponential backoff
+// timer shared by dsync's lock acquisition retry loops.
+package retry
+
+import (
+	"context"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// Jitter selects the randomization strategy applied to each backoff
+// interval produced by NewTimer.
+type Jitter int
+
+const (
+	// NoJitter always waits the full computed backoff.
+	NoJitter Jitter = iota
+
+	// FullJitter waits a random duration between zero and the computed backoff.
+	FullJitter
+
+	// EqualJitter waits half the computed backoff plus a random amount up
+	// to the other half, so every attempt waits at least half the backoff.
+	EqualJitter
+
+	// DecorrelatedJitter bases each wait on the previous one, so that
+	// successive attempts from different callers tend to desynchronize.
+	DecorrelatedJitter
+)
+
+// Timer paces a caller's retry attempts with a truncated exponential
+// backoff. Unlike a free-running ticker, the wait before attempt N is only
+// started once the caller asks for attempt N via Next, i.e. after it has
+// finished whatever work attempt N-1 involved - so slow attempts are never
+// partially or wholly absorbed into the following backoff.
+type Timer struct {
+	unit    time.Duration
+	cap     time.Duration
+	jitter  Jitter
+	attempt int
+	prev    time.Duration
+}
+
+// NewTimer returns a Timer that paces attempts numbered from 1, waiting a
+// truncated exponential backoff of unit*2^attempt (capped at cap) between
+// them, randomized according to jitter.
+func NewTimer(unit time.Duration, cap time.Duration, jitter Jitter) *Timer {
+	return &Timer{unit: unit, cap: cap, jitter: jitter}
+}
+
+// Next blocks until the caller should make its next attempt - sleeping the
+// backoff owed since the previous attempt, or returning immediately for the
+// first one - and returns the next attempt number starting at 1. It returns
+// 0, false if ctx is done before or during the wait.
+func (t *Timer) Next(ctx context.Context) (int, bool) {
+	if t.attempt > 0 {
+		t.prev = backoff(t.unit, t.cap, t.jitter, t.attempt, t.prev)
+
+		select {
+		case <-time.After(t.prev):
+		case <-ctx.Done():
+			return 0, false
+		}
+	}
+
+	select {
+	case <-ctx.Done():
+		return 0, false
+	default:
+	}
+
+	t.attempt++
+	return t.attempt, true
+}
+
+// backoff computes the wait before the next attempt, given the wait used
+// before the current one (needed for DecorrelatedJitter).
+func backoff(unit, cap time.Duration, jitter Jitter, attempt int, prev time.Duration) time.Duration {
+	temp := time.Duration(float64(unit) * math.Pow(2, float64(attempt)))
+	if temp <= 0 || temp > cap {
+		temp = cap
+	}
+
+	switch jitter {
+	case FullJitter:
+		return randDuration(temp)
+
+	case EqualJitter:
+		half := temp / 2
+		return half + randDuration(temp-half)
+
+	case DecorrelatedJitter:
+		upper := prev*3 + unit
+		if upper > cap {
+			upper = cap
+		}
+		if upper < unit {
+			upper = unit
+		}
+		return unit + randDuration(upper-unit)
+
+	default:
+		return temp
+	}
+}
+
+// randDuration returns a random duration in [0, max].
+func randDuration(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(max) + 1))
+}
@@ -0,0 +1,84 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package retry
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTimerAttemptsIncreaseFromOne(t *testing.T) {
+	ctx := context.Background()
+	timer := NewTimer(time.Millisecond, time.Second, NoJitter)
+
+	for want := 1; want <= 3; want++ {
+		got, ok := timer.Next(ctx)
+		if !ok {
+			t.Fatalf("Next() = _, false, want true for attempt %d", want)
+		}
+		if got != want {
+			t.Fatalf("Next() = %d, want %d", got, want)
+		}
+	}
+}
+
+func TestTimerStopsOnCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	timer := NewTimer(time.Millisecond, time.Second, NoJitter)
+	if _, ok := timer.Next(ctx); ok {
+		t.Fatal("Next() = _, true on an already-cancelled context, want false")
+	}
+}
+
+// TestTimerDoesNotOverlapCallerWork guards against the backoff racing the
+// caller's own per-attempt work: the wait before attempt N+1 must only
+// start once the caller asks for it, not the moment attempt N was handed
+// out, or slow work absorbs the backoff and defeats it.
+func TestTimerDoesNotOverlapCallerWork(t *testing.T) {
+	ctx := context.Background()
+	timer := NewTimer(10*time.Millisecond, time.Second, NoJitter)
+
+	if _, ok := timer.Next(ctx); !ok {
+		t.Fatal("Next() = _, false, want true for attempt 1")
+	}
+
+	work := 50 * time.Millisecond
+	time.Sleep(work)
+
+	start := time.Now()
+	if _, ok := timer.Next(ctx); !ok {
+		t.Fatal("Next() = _, false, want true for attempt 2")
+	}
+	elapsed := time.Since(start)
+
+	// Backoff before attempt 2 is unit*2^1 = 20ms. If it were started back
+	// when attempt 1 was handed out (racing the 50ms of simulated work),
+	// this call would return immediately.
+	if elapsed < 15*time.Millisecond {
+		t.Fatalf("Next() returned after %v, want it to still pay the pending backoff", elapsed)
+	}
+}
+
+func TestBackoffCapsAtCap(t *testing.T) {
+	got := backoff(time.Millisecond, 5*time.Millisecond, NoJitter, 10, 0)
+	if got != 5*time.Millisecond {
+		t.Fatalf("backoff() = %v, want capped at 5ms", got)
+	}
+}
@@ -0,0 +1,67 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+// LockArgs are the arguments exchanged with a NetLocker when requesting or
+// releasing a lock.
+type LockArgs struct {
+	Resource string
+
+	// UID identifies one specific acquisition of Resource, generated by
+	// the client at Lock/RLock time and echoed back on Unlock/RUnlock so
+	// a delayed grant or a stale release can't be mistaken for the
+	// current holder's.
+	UID string
+}
+
+// NetLocker is the interface that any distributed lock transport must
+// implement. The built-in net/rpc implementation (ReconnectRPCClient) is
+// just one adapter; a gRPC, HTTP, or in-memory fake transport can satisfy
+// it just as well.
+type NetLocker interface {
+	// Lock tries to acquire an exclusive lock, returning true on success.
+	Lock(args LockArgs) (bool, error)
+
+	// Unlock releases a previously acquired exclusive lock.
+	Unlock(args LockArgs) error
+
+	// RLock tries to acquire a shared (read) lock, returning true on success.
+	RLock(args LockArgs) (bool, error)
+
+	// RUnlock releases a previously acquired shared lock.
+	RUnlock(args LockArgs) error
+
+	// ForceUnlock clears a lock administratively, regardless of who holds it.
+	ForceUnlock(args LockArgs) error
+
+	// Refresh tells this node that args.UID is still held by a live
+	// client, resetting the lease this node tracks for it. It returns
+	// false if this node no longer recognizes args.UID for args.Resource
+	// (e.g. it was already reaped), so the caller knows to stop treating
+	// the lock as held.
+	Refresh(args LockArgs) (bool, error)
+
+	// Expired reports whether this node no longer considers args.UID a
+	// live grant for args.Resource, either because it doesn't hold that
+	// UID at all or because its lease lapsed without a Refresh, so
+	// stale-lock maintenance elsewhere in the cluster can tell its own
+	// copy of that grant is an outlier.
+	Expired(args LockArgs) (bool, error)
+
+	// Close closes the underlying connection to the lock server.
+	Close() error
+}
@@ -0,0 +1,114 @@
+/*
+ * Minio Cloud Storage, (C) 2016 Minio, Inc.
+ *
+ * Licensed under the Apache License, Version 2.0 (the "License");
+ * you may not use this file except in compliance with the License.
+ * You may obtain a copy of the License at
+ *
+ *     http://www.apache.org/licenses/LICENSE-2.0
+ *
+ * Unless required by applicable law or agreed to in writing, software
+ * distributed under the License is distributed on an "AS IS" BASIS,
+ * WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+ * See the License for the specific language governing permissions and
+ * limitations under the License.
+ */
+
+package dsync
+
+import (
+	"net/rpc"
+	"sync"
+)
+
+// ReconnectRPCClient is a NetLocker backed by net/rpc over HTTP. It dials
+// lazily on first use and transparently redials on the next call after a
+// failure, so callers don't need to manage the connection lifecycle
+// themselves.
+type ReconnectRPCClient struct {
+	mutex   sync.Mutex
+	addr    string
+	rpcPath string
+	rpc     *rpc.Client
+}
+
+// newClient returns a NetLocker that talks net/rpc to addr over rpcPath.
+func newClient(addr, rpcPath string) *ReconnectRPCClient {
+	return &ReconnectRPCClient{addr: addr, rpcPath: rpcPath}
+}
+
+// Close closes the underlying connection, if any.
+func (c *ReconnectRPCClient) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.rpc == nil {
+		return nil
+	}
+
+	clnt := c.rpc
+	c.rpc = nil
+	return clnt.Close()
+}
+
+// call places the RPC, lazily dialing first, and drops the connection on
+// error so the next call redials.
+func (c *ReconnectRPCClient) call(serviceMethod string, args interface{}, reply interface{}) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.rpc == nil {
+		clnt, err := rpc.DialHTTPPath("tcp", c.addr, c.rpcPath)
+		if err != nil {
+			return err
+		}
+		c.rpc = clnt
+	}
+
+	if err := c.rpc.Call(serviceMethod, args, reply); err != nil {
+		c.rpc.Close()
+		c.rpc = nil
+		return err
+	}
+
+	return nil
+}
+
+func (c *ReconnectRPCClient) Lock(args LockArgs) (bool, error) {
+	var status bool
+	err := c.call("Dsync.Lock", args, &status)
+	return status, err
+}
+
+func (c *ReconnectRPCClient) Unlock(args LockArgs) error {
+	var status bool
+	return c.call("Dsync.Unlock", args, &status)
+}
+
+func (c *ReconnectRPCClient) RLock(args LockArgs) (bool, error) {
+	var status bool
+	err := c.call("Dsync.RLock", args, &status)
+	return status, err
+}
+
+func (c *ReconnectRPCClient) RUnlock(args LockArgs) error {
+	var status bool
+	return c.call("Dsync.RUnlock", args, &status)
+}
+
+func (c *ReconnectRPCClient) ForceUnlock(args LockArgs) error {
+	var status bool
+	return c.call("Dsync.ForceUnlock", args, &status)
+}
+
+func (c *ReconnectRPCClient) Refresh(args LockArgs) (bool, error) {
+	var ok bool
+	err := c.call("Dsync.Refresh", args, &ok)
+	return ok, err
+}
+
+func (c *ReconnectRPCClient) Expired(args LockArgs) (bool, error) {
+	var expired bool
+	err := c.call("Dsync.Expired", args, &expired)
+	return expired, err
+}